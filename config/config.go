@@ -3,15 +3,89 @@ package config
 import (
 	"encoding/json"
 	"log"
+	"net/url"
 	"os"
+	"strings"
 	"sync/atomic"
 	"time"
 	"unsafe"
+
+	"pando-rta/registry"
 )
 
+// PublisherProfile 描述单个 pub_id 的转发规则：上游覆盖、鉴权信息、按接口的开关、限速。
+// 具体的路径/方法/默认上游地址由 registry 里的服务描述给出，这里只放发行商维度的差异化配置。
+type PublisherProfile struct {
+	PubID            string            `json:"pub_id"`
+	UpstreamBaseURL  string            `json:"upstream_base_url"` // 覆盖 registry 默认上游的 scheme+host，不填则使用 registry 里的地址
+	AuthHeaders      map[string]string `json:"auth_headers"`      // 转发前注入到上游请求的 header，覆盖同名的 registry header
+	DisabledAPIs     map[string]bool   `json:"disabled_apis"`     // api 名 -> 是否禁用该发行商的访问，缺省视为启用
+	QPSPerSecond     float64           `json:"qps_per_second"`    // <= 0 表示不限速
+	QPSPerMinute     float64           `json:"qps_per_minute"`    // <= 0 表示不限速
+	AllowedCountries []string          `json:"allowed_countries"` // 非空时，只有落在名单内的国家才放行
+	BlockedCountries []string          `json:"blocked_countries"` // 命中即拒绝，优先级高于 AllowedCountries
+}
+
+// IsAPIEnabled 判断该发行商是否允许访问某个 api（按 registry 里的 api 名）。
+func (p *PublisherProfile) IsAPIEnabled(apiName string) bool {
+	return !p.DisabledAPIs[apiName]
+}
+
+// CountryAllowed 按 BlockedCountries/AllowedCountries 判断该发行商是否允许某个国家访问。
+// country 为空说明 GeoIP 没能识别这个 IP：没配置地域名单时不受影响，
+// 但只要配了名单就按“未知地区”兜底拒绝，不能因为查不到就放行。
+func (p *PublisherProfile) CountryAllowed(country string) bool {
+	if country == "" {
+		return len(p.AllowedCountries) == 0 && len(p.BlockedCountries) == 0
+	}
+	if containsFold(p.BlockedCountries, country) {
+		return false
+	}
+	if len(p.AllowedCountries) > 0 && !containsFold(p.AllowedCountries, country) {
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveUpstream 用发行商的 UpstreamBaseURL 覆盖默认上游地址的 scheme+host，
+// 保留 registry 里配置的路径和查询参数；未设置覆盖地址时原样返回默认地址。
+func (p *PublisherProfile) ResolveUpstream(defaultURL string) string {
+	if p.UpstreamBaseURL == "" {
+		return defaultURL
+	}
+	base, err := url.Parse(p.UpstreamBaseURL)
+	if err != nil {
+		return defaultURL
+	}
+	target, err := url.Parse(defaultURL)
+	if err != nil {
+		return defaultURL
+	}
+	target.Scheme = base.Scheme
+	target.Host = base.Host
+	return target.String()
+}
+
 type Config struct {
-	ValidPubIDs []string        `json:"valid_pub_ids"`
-	validSet    map[string]bool // 用于快速查找的 set
+	ValidPubIDs []*PublisherProfile          `json:"valid_pub_ids"`
+	Logging     LoggingConfig                `json:"logging"`
+	GeoIP       GeoIPConfig                  `json:"geoip"`
+	profiles    map[string]*PublisherProfile // 用于快速查找的 set
+}
+
+// GeoIPConfig 配置离线 GeoIP 库的路径和刷新间隔。
+type GeoIPConfig struct {
+	DBPath             string `json:"db_path"`
+	RefreshIntervalSec int    `json:"refresh_interval_sec"`
 }
 
 var (
@@ -22,6 +96,8 @@ var (
 func init() {
 	// 初始化配置
 	loadConfig()
+	// 加载服务/接口注册表
+	registry.Load()
 	// 启动定时刷新
 	go refreshConfig()
 }
@@ -32,7 +108,43 @@ func GetConfig() *Config {
 }
 
 func (c *Config) IsValidPubID(pubID string) bool {
-	return c.validSet[pubID]
+	_, ok := c.profiles[pubID]
+	return ok
+}
+
+// GetPublisher 返回 pub_id 对应的发行商画像，不存在时返回 false。
+func (c *Config) GetPublisher(pubID string) (*PublisherProfile, bool) {
+	p, ok := c.profiles[pubID]
+	return p, ok
+}
+
+func newDefaultConfig() *Config {
+	c := &Config{
+		ValidPubIDs: []*PublisherProfile{
+			{PubID: "NovaBeyond"},
+			{PubID: "ByteMedia"},
+			{PubID: "FlyFunAds"},
+			{PubID: "PinkTomato"},
+		},
+		Logging: defaultLoggingConfig(),
+		GeoIP: GeoIPConfig{
+			DBPath:             "./geoip.csv",
+			RefreshIntervalSec: 300,
+		},
+	}
+	c.buildIndex()
+	return c
+}
+
+// buildIndex 根据 ValidPubIDs 构建按 pub_id 查找的索引
+func (c *Config) buildIndex() {
+	c.profiles = make(map[string]*PublisherProfile, len(c.ValidPubIDs))
+	for _, p := range c.ValidPubIDs {
+		if p == nil || p.PubID == "" {
+			continue
+		}
+		c.profiles[p.PubID] = p
+	}
 }
 
 // loadConfig 从文件加载配置
@@ -40,16 +152,7 @@ func loadConfig() {
 	file, err := os.Open(configPath)
 	if err != nil {
 		log.Printf("Failed to open config file: %v, using default config", err)
-		// 使用默认配置
-		defaultConfig := &Config{
-			ValidPubIDs: []string{"NovaBeyond", "ByteMedia", "FlyFunAds", "PinkTomato"},
-		}
-		// 构建 set
-		defaultConfig.validSet = make(map[string]bool)
-		for _, id := range defaultConfig.ValidPubIDs {
-			defaultConfig.validSet[id] = true
-		}
-		atomic.StorePointer(&config, unsafe.Pointer(defaultConfig))
+		atomic.StorePointer(&config, unsafe.Pointer(newDefaultConfig()))
 		return
 	}
 	defer file.Close()
@@ -57,30 +160,18 @@ func loadConfig() {
 	var newConfig Config
 	if err := json.NewDecoder(file).Decode(&newConfig); err != nil {
 		log.Printf("Failed to decode config file: %v, using default config", err)
-		// 使用默认配置
-		defaultConfig := &Config{
-			ValidPubIDs: []string{"NovaBeyond", "ByteMedia", "FlyFunAds", "PinkTomato"},
-		}
-		// 构建 set
-		defaultConfig.validSet = make(map[string]bool)
-		for _, id := range defaultConfig.ValidPubIDs {
-			defaultConfig.validSet[id] = true
-		}
-		atomic.StorePointer(&config, unsafe.Pointer(defaultConfig))
+		atomic.StorePointer(&config, unsafe.Pointer(newDefaultConfig()))
 		return
 	}
 
 	// 构建 set
-	newConfig.validSet = make(map[string]bool)
-	for _, id := range newConfig.ValidPubIDs {
-		newConfig.validSet[id] = true
-	}
+	newConfig.buildIndex()
 
 	atomic.StorePointer(&config, unsafe.Pointer(&newConfig))
 	log.Println("Config loaded successfully")
 }
 
-// refreshConfig 每分钟刷新一次配置
+// refreshConfig 每分钟刷新一次配置和服务/接口注册表
 func refreshConfig() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
@@ -88,5 +179,6 @@ func refreshConfig() {
 	for range ticker.C {
 		log.Println("Refreshing config...")
 		loadConfig()
+		registry.Load()
 	}
 }
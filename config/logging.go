@@ -0,0 +1,33 @@
+package config
+
+// LokiConfig 描述可选的 Loki 推送 sink。
+type LokiConfig struct {
+	Enabled   bool              `json:"enabled"`
+	Endpoint  string            `json:"endpoint"` // 形如 http://loki:3100，不含 /loki/api/v1/push
+	Labels    map[string]string `json:"labels"`   // 额外附加到每条日志流的固定 label
+	BatchSize int               `json:"batch_size"`
+	FlushMS   int               `json:"flush_interval_ms"`
+}
+
+// LoggingConfig 描述日志落盘、控制台输出、Loki 推送的参数，均可热更新。
+type LoggingConfig struct {
+	Debug           bool       `json:"debug"` // 打开后额外输出彩色控制台日志
+	InfoLogPath     string     `json:"info_log_path"`
+	InfoMaxSizeMB   int        `json:"info_max_size_mb"`
+	InfoMaxBackups  int        `json:"info_max_backups"`
+	ErrorLogPath    string     `json:"error_log_path"`
+	ErrorMaxSizeMB  int        `json:"error_max_size_mb"`
+	ErrorMaxBackups int        `json:"error_max_backups"`
+	Loki            LokiConfig `json:"loki"`
+}
+
+func defaultLoggingConfig() LoggingConfig {
+	return LoggingConfig{
+		InfoLogPath:     "./logs/info.log",
+		InfoMaxSizeMB:   1000,
+		InfoMaxBackups:  4000,
+		ErrorLogPath:    "./logs/error.log",
+		ErrorMaxSizeMB:  500,
+		ErrorMaxBackups: 2000,
+	}
+}
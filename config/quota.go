@@ -0,0 +1,104 @@
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket 是一个简单的令牌桶限速器。
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	capacity   float64
+	refillRate float64 // 每秒补充的令牌数
+	lastRefill time.Time
+}
+
+func newTokenBucket(capacity, refillRate float64) *tokenBucket {
+	return &tokenBucket{
+		tokens:     capacity,
+		capacity:   capacity,
+		refillRate: refillRate,
+		lastRefill: time.Now(),
+	}
+}
+
+// allow 尝试消费一个令牌，返回是否放行以及建议的重试等待时间。
+func (b *tokenBucket) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.lastRefill = now
+
+	b.tokens += elapsed * b.refillRate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	// 不够一个令牌时，估算还需要多久能攒够
+	deficit := 1 - b.tokens
+	wait := time.Duration(deficit/b.refillRate*float64(time.Second)) + time.Millisecond
+	return false, wait
+}
+
+// pubQuota 保存某个 pub_id 同时生效的秒级和分钟级令牌桶。
+// 额外记下构建时用的限速值，配置热更新改了 QPS 之后能发现桶已经过期。
+type pubQuota struct {
+	qpsPerSecond float64
+	qpsPerMinute float64
+	perSecond    *tokenBucket
+	perMinute    *tokenBucket
+}
+
+var (
+	quotaMu sync.Mutex
+	quotas  = make(map[string]*pubQuota)
+)
+
+// CheckQuota 对照发行商画像里配置的 QPS 上限消费一次配额。
+// ok 为 false 时，retryAfter 给出建议的 Retry-After 等待时长。
+func CheckQuota(p *PublisherProfile) (ok bool, retryAfter time.Duration) {
+	if p.QPSPerSecond <= 0 && p.QPSPerMinute <= 0 {
+		return true, 0
+	}
+
+	quotaMu.Lock()
+	q, exists := quotas[p.PubID]
+	if !exists || q.qpsPerSecond != p.QPSPerSecond || q.qpsPerMinute != p.QPSPerMinute {
+		// 画像不存在缓存的桶，或者配置热更新改了 QPS 上限：重建一个新桶，
+		// 旧桶里攒的令牌直接丢弃——限速值都变了，没有继续复用的意义。
+		q = buildPubQuota(p)
+		quotas[p.PubID] = q
+	}
+	quotaMu.Unlock()
+
+	if q.perSecond != nil {
+		if allowed, wait := q.perSecond.allow(); !allowed {
+			return false, wait
+		}
+	}
+	if q.perMinute != nil {
+		if allowed, wait := q.perMinute.allow(); !allowed {
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+func buildPubQuota(p *PublisherProfile) *pubQuota {
+	q := &pubQuota{qpsPerSecond: p.QPSPerSecond, qpsPerMinute: p.QPSPerMinute}
+	if p.QPSPerSecond > 0 {
+		q.perSecond = newTokenBucket(p.QPSPerSecond, p.QPSPerSecond)
+	}
+	if p.QPSPerMinute > 0 {
+		q.perMinute = newTokenBucket(p.QPSPerMinute, p.QPSPerMinute/60)
+	}
+	return q
+}
@@ -0,0 +1,198 @@
+// Package geoip 提供一个基于 IP 段的轻量离线地理位置查询，
+// 用于给访问日志打上国家/省份/城市/ISP 标签，以及按国家做发行商级别的准入控制。
+//
+// 数据库是一份纯文本 CSV：每行
+//
+//	start_ip,end_ip,country,province,city,isp,continent,tz,lat,lon
+//
+// 按起始 IP 排好序后整体载入内存，用二分查找定位命中的网段。
+package geoip
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"pando-rta/config"
+)
+
+// Record 是一次查询命中的地理位置信息。
+type Record struct {
+	Country   string
+	Province  string
+	City      string
+	ISP       string
+	Continent string
+	TZ        string
+	Lat       float64
+	Lon       float64
+}
+
+// ipKey 统一用 16 字节表示 IPv4/IPv6 地址（net.IP.To16 把 IPv4 映射成
+// ::ffff:a.b.c.d），这样库里的网段和查询的客户端 IP 按同一种方式比较，
+// 不再只支持 IPv4。
+type ipKey [16]byte
+
+func toKey(ip net.IP) (ipKey, bool) {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return ipKey{}, false
+	}
+	var k ipKey
+	copy(k[:], ip16)
+	return k, true
+}
+
+type ipRange struct {
+	start ipKey
+	end   ipKey
+	rec   Record
+}
+
+type db struct {
+	ranges   []ipRange // 按 start 升序排列
+	loadedAt time.Time // 跟 ranges 一起原子替换，避免单独一个 time.Time 被并发读写
+}
+
+var current unsafe.Pointer // *db
+
+func init() {
+	atomic.StorePointer(&current, unsafe.Pointer(&db{}))
+	Load()
+	go refreshLoop()
+}
+
+// Load 按 config.Config 里配置的路径重新加载数据库并原子替换。
+// 文件不存在或解析失败时保留上一次的数据，正在进行中的 Lookup 不会读到半份数据。
+func Load() {
+	path := config.GetConfig().GeoIP.DBPath
+	if path == "" {
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("geoip: failed to open db %q: %v, keeping previous data", path, err)
+		return
+	}
+	defer f.Close()
+
+	next, err := parseDB(f)
+	if err != nil {
+		log.Printf("geoip: failed to parse db %q: %v, keeping previous data", path, err)
+		return
+	}
+
+	next.loadedAt = time.Now()
+	atomic.StorePointer(&current, unsafe.Pointer(next))
+	log.Printf("geoip: loaded %d ranges from %s", len(next.ranges), path)
+}
+
+// refreshLoop 定期检查一次，按 config 里配置的刷新间隔决定是否重新加载数据库。
+func refreshLoop() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		interval := time.Duration(config.GetConfig().GeoIP.RefreshIntervalSec) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		loadedAt := (*db)(atomic.LoadPointer(&current)).loadedAt
+		if time.Since(loadedAt) >= interval {
+			Load()
+		}
+	}
+}
+
+func parseDB(r io.Reader) (*db, error) {
+	scanner := bufio.NewScanner(r)
+	var ranges []ipRange
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 10 {
+			continue
+		}
+		start, err := ipToKey(fields[0])
+		if err != nil {
+			continue
+		}
+		end, err := ipToKey(fields[1])
+		if err != nil {
+			continue
+		}
+		lat, _ := strconv.ParseFloat(fields[8], 64)
+		lon, _ := strconv.ParseFloat(fields[9], 64)
+		ranges = append(ranges, ipRange{
+			start: start,
+			end:   end,
+			rec: Record{
+				Country:   fields[2],
+				Province:  fields[3],
+				City:      fields[4],
+				ISP:       fields[5],
+				Continent: fields[6],
+				TZ:        fields[7],
+				Lat:       lat,
+				Lon:       lon,
+			},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return bytes.Compare(ranges[i].start[:], ranges[j].start[:]) < 0 })
+	return &db{ranges: ranges}, nil
+}
+
+func ipToKey(s string) (ipKey, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return ipKey{}, fmt.Errorf("invalid ip %q", s)
+	}
+	k, ok := toKey(ip)
+	if !ok {
+		return ipKey{}, fmt.Errorf("invalid ip %q", s)
+	}
+	return k, nil
+}
+
+// Lookup 返回某个 IP（IPv4/IPv6 均可）命中的地理位置信息，
+// 查不到（或解析失败）时 ok 为 false。
+func Lookup(ip string) (Record, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Record{}, false
+	}
+	target, ok := toKey(parsed)
+	if !ok {
+		return Record{}, false
+	}
+
+	d := (*db)(atomic.LoadPointer(&current))
+	ranges := d.ranges
+	idx := sort.Search(len(ranges), func(i int) bool { return bytes.Compare(ranges[i].start[:], target[:]) > 0 })
+	if idx == 0 {
+		return Record{}, false
+	}
+	r := ranges[idx-1]
+	if bytes.Compare(target[:], r.start[:]) >= 0 && bytes.Compare(target[:], r.end[:]) <= 0 {
+		return r.rec, true
+	}
+	return Record{}, false
+}
@@ -0,0 +1,142 @@
+// Package logging 组装 zap 的多个输出核心（按级别分文件滚动、可选控制台、
+// 可选 Loki 推送），并用原子指针让配置变化时安全地重建 logger。
+package logging
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"pando-rta/config"
+)
+
+// instance 是一次 build 的产物：logger 本身，以及重建时需要回收的资源——
+// lumberjack 的文件句柄和 Loki 推送协程都只能在确认没人用之后才能关掉。
+type instance struct {
+	logger   *zap.Logger
+	cfg      config.LoggingConfig
+	closers  []io.Closer
+	lokiStop chan struct{}
+}
+
+var current unsafe.Pointer // *instance
+
+func init() {
+	atomic.StorePointer(&current, unsafe.Pointer(build(config.GetConfig().Logging)))
+	go refreshLoop()
+}
+
+// L 返回当前生效的 logger，配置热更新后会自动切换到重建后的实例。
+func L() *zap.Logger {
+	return (*instance)(atomic.LoadPointer(&current)).logger
+}
+
+// Reload 只有在配置真的变化时才重建 logger 并原子替换，避免每分钟都白白
+// 新开一批 lumberjack 文件句柄和 Loki 推送协程。旧实例在替换后统一回收。
+func Reload() {
+	cfg := config.GetConfig().Logging
+	old := (*instance)(atomic.LoadPointer(&current))
+	if reflect.DeepEqual(old.cfg, cfg) {
+		return
+	}
+
+	next := build(cfg)
+	atomic.StorePointer(&current, unsafe.Pointer(next))
+
+	_ = old.logger.Sync()
+	for _, c := range old.closers {
+		_ = c.Close()
+	}
+	if old.lokiStop != nil {
+		close(old.lokiStop)
+	}
+}
+
+// refreshLoop 每分钟检查一次配置，和 config 包刷新配置的周期保持一致。
+func refreshLoop() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		Reload()
+	}
+}
+
+func build(cfg config.LoggingConfig) *instance {
+	if err := os.MkdirAll("./logs", 0755); err != nil {
+		panic(err)
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	jsonEncoder := zapcore.NewJSONEncoder(encoderConfig)
+
+	infoWriter := &lumberjack.Logger{
+		Filename:   orDefault(cfg.InfoLogPath, "./logs/info.log"),
+		MaxSize:    intOrDefault(cfg.InfoMaxSizeMB, 1000),
+		MaxBackups: intOrDefault(cfg.InfoMaxBackups, 4000),
+		MaxAge:     28,
+		Compress:   true,
+	}
+	errorWriter := &lumberjack.Logger{
+		Filename:   orDefault(cfg.ErrorLogPath, "./logs/error.log"),
+		MaxSize:    intOrDefault(cfg.ErrorMaxSizeMB, 500),
+		MaxBackups: intOrDefault(cfg.ErrorMaxBackups, 2000),
+		MaxAge:     28,
+		Compress:   true,
+	}
+	closers := []io.Closer{infoWriter, errorWriter}
+
+	cores := []zapcore.Core{
+		// info 核心：>= InfoLevel 全量写入，保留原来的行为
+		zapcore.NewCore(jsonEncoder, zapcore.AddSync(infoWriter), zapcore.InfoLevel),
+		// error 核心：只写 >= ErrorLevel，单独的文件方便排障时只看错误
+		zapcore.NewCore(jsonEncoder, zapcore.AddSync(errorWriter), zapcore.ErrorLevel),
+	}
+
+	if cfg.Debug {
+		consoleEncoderConfig := zap.NewDevelopmentEncoderConfig()
+		consoleEncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		cores = append(cores, zapcore.NewCore(
+			zapcore.NewConsoleEncoder(consoleEncoderConfig),
+			zapcore.AddSync(os.Stdout),
+			zapcore.DebugLevel,
+		))
+	}
+
+	var lokiStop chan struct{}
+	if cfg.Loki.Enabled && cfg.Loki.Endpoint != "" {
+		var core zapcore.Core
+		core, lokiStop = newLokiCore(cfg.Loki, jsonEncoder)
+		cores = append(cores, core)
+	}
+
+	return &instance{
+		logger:   zap.New(zapcore.NewTee(cores...)),
+		cfg:      cfg,
+		closers:  closers,
+		lokiStop: lokiStop,
+	}
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func intOrDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,201 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"pando-rta/config"
+)
+
+// lokiEntry 是一条待推送的日志行，labels 是 {app,pub_id,endpoint} 这类流标签。
+type lokiEntry struct {
+	ts     time.Time
+	line   string
+	labels map[string]string
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// lokiState 是多个 lokiCore（经 With() 派生出来的）共享的批次缓冲区和 HTTP 客户端。
+type lokiState struct {
+	mu        sync.Mutex
+	pending   []lokiEntry
+	pushURL   string
+	baseLabel map[string]string
+	batchCap  int
+	client    *http.Client
+}
+
+func (s *lokiState) append(e lokiEntry) {
+	s.mu.Lock()
+	s.pending = append(s.pending, e)
+	full := len(s.pending) >= s.batchCap
+	s.mu.Unlock()
+
+	if full {
+		go s.flush()
+	}
+}
+
+func (s *lokiState) flush() {
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	streams := map[string]*lokiStream{}
+	for _, e := range batch {
+		key := labelKey(e.labels)
+		st, ok := streams[key]
+		if !ok {
+			st = &lokiStream{Stream: e.labels}
+			streams[key] = st
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+	}
+
+	payload := lokiPushRequest{Streams: make([]lokiStream, 0, len(streams))}
+	for _, st := range streams {
+		payload.Streams = append(payload.Streams, *st)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, s.pushURL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return
+	}
+	_ = resp.Body.Close()
+}
+
+// loop 定期把攒够的批次推给 Loki，直到 stop 被关闭——logger 重建时旧的
+// lokiCore 没人再写了，关掉 stop 让这个协程退出前再 flush 一次，不留尾巴。
+func (s *lokiState) loop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// lokiCore 是一个 zapcore.Core，把写入的条目攒批后异步推到 Loki。
+type lokiCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	fields []zapcore.Field
+	state  *lokiState
+}
+
+// newLokiCore 建好一个 lokiCore 和它专属的批量推送协程，并把这个协程的
+// 停止信号一并返回，调用方（logging.build）要负责在 logger 被替换掉之后关闭它。
+func newLokiCore(cfg config.LokiConfig, enc zapcore.Encoder) (zapcore.Core, chan struct{}) {
+	state := &lokiState{
+		pushURL:   strings.TrimRight(cfg.Endpoint, "/") + "/loki/api/v1/push",
+		baseLabel: cfg.Labels,
+		batchCap:  intOrDefault(cfg.BatchSize, 100),
+		client:    &http.Client{Timeout: 5 * time.Second},
+	}
+	stop := make(chan struct{})
+	go state.loop(time.Duration(intOrDefault(cfg.FlushMS, 2000))*time.Millisecond, stop)
+
+	return &lokiCore{
+		LevelEnabler: zapcore.InfoLevel,
+		enc:          enc,
+		state:        state,
+	}, stop
+}
+
+func (c *lokiCore) With(fields []zapcore.Field) zapcore.Core {
+	return &lokiCore{
+		LevelEnabler: c.LevelEnabler,
+		enc:          c.enc.Clone(),
+		fields:       append(append([]zapcore.Field{}, c.fields...), fields...),
+		state:        c.state,
+	}
+}
+
+func (c *lokiCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *lokiCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(entry, append(c.fields, fields...))
+	if err != nil {
+		return err
+	}
+	line := strings.TrimRight(buf.String(), "\n")
+	buf.Free()
+
+	labels := map[string]string{"app": "pando-rta"}
+	for k, v := range c.state.baseLabel {
+		labels[k] = v
+	}
+	var decoded map[string]interface{}
+	if json.Unmarshal([]byte(line), &decoded) == nil {
+		if v, ok := decoded["pub_id"].(string); ok && v != "" {
+			labels["pub_id"] = v
+		}
+		if v, ok := decoded["path"].(string); ok && v != "" {
+			labels["endpoint"] = v
+		}
+	}
+
+	c.state.append(lokiEntry{ts: entry.Time, line: line, labels: labels})
+	return nil
+}
+
+func (c *lokiCore) Sync() error {
+	c.state.flush()
+	return nil
+}
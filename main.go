@@ -2,60 +2,21 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
-	"gopkg.in/natefinch/lumberjack.v2"
 	"io"
 	"net/http"
-	"os"
 	"pando-rta/config"
+	"pando-rta/geoip"
+	"pando-rta/logging"
+	"pando-rta/registry"
+	"strconv"
 	"strings"
 )
 
-const (
-	TargetAPINetwork = "https://growth-rta.tiktokv-us.com/api/v1/rta/network"
-	TargetAPIReport  = "https://growth-rta.tiktokv-us.com/api/v1/rta/report"
-	LogFile          = "./logs/api.log" // 所有日志写入这个文件，lumberjack 负责滚动
-	MaxSize          = 1000             // 每个日志文件最大 100MB
-	MaxBackups       = 4000             // 最多保留 10 个备份文件
-)
-
-// 初始化日志（每天一个文件，使用 lumberjack 滚动）
-var logger *zap.Logger
-
-func initLogger() {
-	// 创建日志目录
-	if err := os.MkdirAll("./logs", 0755); err != nil {
-		panic(err)
-	}
-
-	// 使用 lumberjack 按大小滚动
-	w := &lumberjack.Logger{
-		Filename:   LogFile,    // 基础日志文件
-		MaxSize:    MaxSize,    // MB
-		MaxBackups: MaxBackups, // 保留 10 个旧文件
-		MaxAge:     28,         // 旧文件最多保留 28 天（防无限堆积）
-		Compress:   true,       // 压缩旧文件为 .gz
-	}
-
-	// JSON 编码器
-	encoderConfig := zap.NewProductionEncoderConfig()
-	encoderConfig.TimeKey = "time"
-	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-
-	core := zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderConfig),
-		zapcore.AddSync(w),
-		zapcore.InfoLevel,
-	)
-
-	logger = zap.New(core)
-}
-
 func main() {
-	initLogger()
-	defer logger.Sync() // 确保日志刷写
+	defer func() { _ = logging.L().Sync() }() // 确保日志刷写
 
 	r := gin.New()
 
@@ -66,119 +27,182 @@ func main() {
 		c.Abort() // 不再执行后续中间件
 	})
 
-	// 添加日志中间件
-	r.Use(func(c *gin.Context) {
-		if c.Request.URL.Path == "/hc" {
-			c.Next()
-			return
-		}
-
-		pubID := c.Query("pub_id")
-		if pubID == "" {
-			pubID = "unknown"
-		}
+	// 添加 recovery + 日志中间件
+	r.Use(GinRecovery(true))
+	r.Use(GinLogger())
 
-		body, _ := io.ReadAll(c.Request.Body)
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(body)) // 重置 body
-
-		// 记录请求
-		logger.Info("request received",
-			zap.String("client_ip", c.ClientIP()),
-			zap.String("method", c.Request.Method),
-			zap.String("url", c.Request.URL.String()),
-			zap.String("pub_id", pubID),
-			zap.ByteString("body", body),
-		)
-
-		c.Next()
-	})
-	// 接口 B：接收请求，转发到接口 A
-	r.POST("/api/v1/rta/network", proxyHandler)
-	r.POST("/api/v1/rta/report", proxyHandler)
+	// 所有未命中固定路由的请求都走注册表驱动的通用转发
+	r.NoRoute(rpcHandler)
 
 	// 启动服务
 	r.Run(":8080") // 可以修改端口
 }
 
-func proxyHandler(c *gin.Context) {
+// rpcHandler 按请求路径在注册表里查找对应的 service/api 定义并转发，
+// 取代了过去写死 /api/v1/rta/network、/api/v1/rta/report 两个路由的做法。
+func rpcHandler(c *gin.Context) {
+	_, api, ok := registry.Lookup(c.Request.URL.Path)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown endpoint"})
+		return
+	}
+	if !strings.EqualFold(api.Method, c.Request.Method) {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "method not allowed"})
+		return
+	}
+	proxyHandler(c, api)
+}
+
+func proxyHandler(c *gin.Context, api *registry.Api) {
 	// 1. 解析请求，获取 pub_id（作为查询参数或 body？根据你的需求）
 	pubID := c.Query("pub_id") // 假设 pub_id 是 query 参数
 	if pubID == "" || pubID == "unknown" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing pub_id"})
 		return
 	}
-	if !config.GetConfig().IsValidPubID(pubID) {
+	profile, ok := config.GetConfig().GetPublisher(pubID)
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pub_id"})
 		return
 	}
-	// 2. 读取原始请求 Body（包含接口 A 所需的所有参数）
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+
+	// 2. 按发行商画像判断该接口是否开放、来源地区是否允许，并核对 QPS 配额
+	if !profile.IsAPIEnabled(api.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "endpoint disabled for pub_id"})
 		return
 	}
-	_ = c.Request.Body.Close()
-
-	// 3. 构造转发到接口 A 的请求
-	var targetURL string
-	if c.Request.URL.Path == "/api/v1/rta/network" {
-		targetURL = TargetAPINetwork
-	} else if c.Request.URL.Path == "/api/v1/rta/report" {
-		targetURL = TargetAPIReport
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported endpoint"})
+	// geo.Country 查不到时是空字符串，CountryAllowed 在发行商配置了地域名单的
+	// 情况下会把空国家当未知地区拒绝，不会因为 GeoIP 查不到就直接放行。
+	geo, _ := geoip.Lookup(c.ClientIP())
+	if !profile.CountryAllowed(geo.Country) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "region not allowed for pub_id"})
 		return
 	}
-	req, err := http.NewRequestWithContext(c.Request.Context(), "POST", targetURL, bytes.NewBuffer(body))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "rta request failed"})
+	if allowed, retryAfter := config.CheckQuota(profile); !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+1)))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "quota exceeded for pub_id"})
 		return
 	}
 
-	// 4. 复制原始请求的 Headers（除了 Host）
-	for key, values := range c.Request.Header {
-		if strings.ToLower(key) != "host" {
-			req.Header.Del(key) // 先清空
-			for _, value := range values {
-				req.Header.Add(key, value)
-			}
+	targetURL := profile.ResolveUpstream(api.UpstreamURL)
+
+	// 3. 构造转发请求体：不重试的 api 直接流式转发原始 Body，不做整包
+	// ReadAll；需要支持重试的 api 先把 body 读进不超过 maxRetryBufferBytes
+	// 的副本，每次尝试重放同一份内容，请求体比这个上限还大就放弃重试，只发一次。
+	// 请求体日志已经由 GinLogger 采样过，这里不用再重复采一遍。
+	newReqBody := requestBodyFactory(c, api.Retries)
+
+	// 4. 使用 api 专属的 http.Client 发起请求，失败时按配置的重试次数退避重试
+	resp, err := api.Do(func() (*http.Request, error) {
+		body, err := newReqBody()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(c.Request.Context(), api.Method, targetURL, body)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	// 5. 使用 http.Client 发起请求
-	client := &http.Client{}
-	resp, err := client.Do(req)
+		// 复制原始请求的 Headers（除了 Host）
+		for key, values := range c.Request.Header {
+			if strings.ToLower(key) != "host" {
+				req.Header.Del(key) // 先清空
+				for _, value := range values {
+					req.Header.Add(key, value)
+				}
+			}
+		}
+		// 注入 api 固定 header，再用发行商的鉴权 header 覆盖同名项
+		for key, value := range api.Headers {
+			req.Header.Set(key, value)
+		}
+		for key, value := range profile.AuthHeaders {
+			req.Header.Set(key, value)
+		}
+		return req, nil
+	})
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "rta request failed"})
 		return
 	}
 	defer resp.Body.Close()
 
-	// 6. 读取响应体以便记录日志
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to read response body"})
-		return
+	// 5. 复制响应 Header 和状态码，再把响应体边读边写流式转发给客户端，
+	// 同时用 TeeReader 采样前 4KB 写进日志，避免为记录日志整包缓冲响应体。
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Header(key, value)
+		}
 	}
+	c.Status(resp.StatusCode)
+
+	respSample := newBoundedSink(maxLoggedBodyBytes)
+	written, copyErr := io.Copy(c.Writer, io.TeeReader(resp.Body, respSample))
 
-	// 7. 记录响应日志
-	logger.Info("response sent",
+	// 6. 记录响应日志
+	logging.L().Info("response sent",
 		zap.String("pub_id", pubID),
 		zap.String("target_url", targetURL),
 		zap.Int("status_code", resp.StatusCode),
-		zap.ByteString("response_body", respBody),
+		zap.Int64("response_bytes", written),
+		zap.ByteString("response_body_sample", respSample.Bytes()),
 	)
+	if copyErr != nil {
+		logging.L().Warn("response copy interrupted",
+			zap.String("pub_id", pubID),
+			zap.Error(copyErr),
+		)
+	}
+}
 
-	// 8. 复制响应 Header
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Header(key, value)
-		}
+// maxRetryBufferBytes 限制为了支持失败重放而额外攒的请求体副本大小，
+// 超过这个体积就不再缓冲——重试本来就是个例外情况，不该因为它把所有请求
+// 体都读进内存。
+const maxRetryBufferBytes = 1 << 20 // 1MB
+
+// requestBodyFactory 返回一个可重复调用来产出请求体 io.Reader 的工厂函数，
+// 每次调用对应 api.Do 的一次尝试。
+// retries <= 0 时直接流式返回原始 Body，不做整包 ReadAll。
+// retries > 0 时说明同一份 body 可能要发不止一次：不能靠 TeeReader 跟着第
+// 一次尝试顺带攒副本，因为失败往往发生在 body 还没读完的时候（拨号失败、
+// 连接中途被重置），那样重放出去的就是截断甚至是空的请求体。所以这里提
+// 前把 body 读到不超过 maxRetryBufferBytes 的副本里，每次尝试都重放同一
+// 份完整内容；body 超过这个上限就放弃重试能力，退化成流式转发一次。
+func requestBodyFactory(c *gin.Context, retries int) func() (io.Reader, error) {
+	if retries <= 0 {
+		return streamOnceFactory(c.Request.Body)
 	}
 
-	// 9. 设置相同的 Status Code
-	c.Status(resp.StatusCode)
+	prefix := make([]byte, maxRetryBufferBytes+1)
+	n, err := io.ReadFull(c.Request.Body, prefix)
+	switch {
+	case err == nil:
+		// prefix 被整个填满，说明 body 还有剩余没读完，超过了重放上限。
+		rest := io.MultiReader(bytes.NewReader(prefix), c.Request.Body)
+		return streamOnceFactory(rest)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		body := prefix[:n]
+		return func() (io.Reader, error) {
+			return bytes.NewReader(body), nil
+		}
+	default:
+		return func() (io.Reader, error) {
+			return nil, err
+		}
+	}
+}
 
-	// 10. 将接口 A 的响应体原样返回
-	c.Writer.Write(respBody)
+// streamOnceFactory 包一层只能被成功消费一次的 io.Reader 工厂，
+// 用于不支持重放的请求体（零重试，或者重试体积超限退化成单次流式转发）。
+func streamOnceFactory(r io.Reader) func() (io.Reader, error) {
+	used := false
+	return func() (io.Reader, error) {
+		if used {
+			// body 已被第一次尝试消费，无法重放：返回错误让 Do() 就此结束，
+			// 不会把空 body 当作重试再发一次。
+			return nil, errors.New("request body cannot be replayed")
+		}
+		used = true
+		return r, nil
+	}
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"pando-rta/geoip"
+	"pando-rta/logging"
+)
+
+// maxLoggedBodyBytes 限制请求体被记录到日志的大小，超出部分不读入内存，避免大文件上传把日志打爆。
+const maxLoggedBodyBytes = 4 << 10 // 4KB
+
+// GinLogger 记录每个请求的方法、路径、query、状态码、响应体大小、耗时、
+// 客户端 IP、User-Agent，并生成（或透传）X-Request-ID。
+func GinLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		query := c.Request.URL.RawQuery
+
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		c.Writer.Header().Set("X-Request-ID", requestID)
+		c.Set("request_id", requestID)
+
+		// 只把前 maxLoggedBodyBytes 读进内存用于日志采样，
+		// 其余部分原样拼回去，后续处理器仍能读到完整 body。
+		sample, _ := io.ReadAll(io.LimitReader(c.Request.Body, maxLoggedBodyBytes))
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(sample), c.Request.Body))
+
+		pubID := c.Query("pub_id")
+		if pubID == "" {
+			pubID = "unknown"
+		}
+
+		c.Next()
+
+		fields := []zap.Field{
+			zap.String("request_id", requestID),
+			zap.String("method", c.Request.Method),
+			zap.String("path", path),
+			zap.String("query", query),
+			zap.Int("status", c.Writer.Status()),
+			zap.Int("response_size", c.Writer.Size()),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+			zap.String("pub_id", pubID),
+			zap.ByteString("body", sample),
+		}
+		if geo, ok := geoip.Lookup(c.ClientIP()); ok {
+			fields = append(fields,
+				zap.String("country", geo.Country),
+				zap.String("city", geo.City),
+				zap.String("isp", geo.ISP),
+			)
+		}
+		logging.L().Info("request handled", fields...)
+	}
+}
+
+// GinRecovery 兜底 panic，区分客户端断开连接（broken pipe / connection reset）
+// 和真正的程序异常：前者只记 warn 不返回 500，后者记完整堆栈并返回 JSON 500。
+func GinRecovery(stack bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			log := logging.L()
+			requestID, _ := c.Get("request_id")
+
+			if brokenPipe := isBrokenPipe(rec); brokenPipe {
+				log.Warn("broken connection",
+					zap.Any("request_id", requestID),
+					zap.Any("error", rec),
+				)
+				c.Abort()
+				return
+			}
+
+			fields := []zap.Field{
+				zap.Any("request_id", requestID),
+				zap.Any("error", rec),
+			}
+			if stack {
+				fields = append(fields, zap.Stack("stack"))
+			}
+			log.Error("panic recovered", fields...)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}()
+		c.Next()
+	}
+}
+
+// isBrokenPipe 判断 panic 的值是否是客户端断开连接导致的网络错误。
+func isBrokenPipe(rec any) bool {
+	err, ok := rec.(error)
+	if !ok {
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		var sysErr *os.SyscallError
+		if errors.As(opErr.Err, &sysErr) {
+			msg := strings.ToLower(sysErr.Error())
+			return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+		}
+	}
+
+	var sysErr *os.SyscallError
+	if errors.As(err, &sysErr) {
+		msg := strings.ToLower(sysErr.Error())
+		return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+	}
+
+	return false
+}
+
+// newRequestID 生成一个 16 字节随机十六进制串作为请求 ID。
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format("20060102150405.000000000")))
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,200 @@
+// Package registry 维护一张从网关对外路径到上游接口定义的路由表，
+// 使 pando-rta 从写死两个端点的转发器变成按配置驱动的通用 RTA 网关。
+package registry
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Api 描述注册表里的一个具体接口：对外暴露的路径、请求方法、
+// 默认上游地址、超时、重试次数，以及固定注入的 header。
+type Api struct {
+	Name        string            `json:"name"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`         // 对外暴露的网关路径，例如 /api/v1/rta/network
+	UpstreamURL string            `json:"upstream_url"` // 默认上游地址，发行商画像可覆盖 host
+	TimeoutMS   int               `json:"timeout_ms"`
+	Retries     int               `json:"retries"`
+	Headers     map[string]string `json:"headers"` // 固定注入的 header，发行商 AuthHeaders 优先级更高
+
+	client *http.Client
+}
+
+// Service 是一组相关接口的集合，对应 services 目录下的一个 JSON 文件。
+type Service struct {
+	Name string `json:"name"`
+	Apis []*Api `json:"apis"`
+}
+
+// Timeout 返回该接口的超时时间，未配置时回退到 5s。
+func (a *Api) Timeout() time.Duration {
+	if a.TimeoutMS <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(a.TimeoutMS) * time.Millisecond
+}
+
+// Client 返回该接口专属的 http.Client，在加载路由表时就已经建好连接池，
+// 这里只是单纯读取，不做任何构建——并发的请求 goroutine 共享同一个 *Api，
+// 构建动作绝不能留到这个热路径上做，否则就是一个数据竞争。
+func (a *Api) Client() *http.Client {
+	return a.client
+}
+
+// buildClient 为该接口建立专属的 http.Client/Transport，只在路由表加载时
+// （loadService/defaultTable）调用一次，建好之后整个生命周期内复用。
+func (a *Api) buildClient() {
+	a.client = &http.Client{
+		Timeout: a.Timeout(),
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: 64,
+			IdleConnTimeout:     90 * time.Second,
+			DisableCompression:  false,
+			ForceAttemptHTTP2:   true,
+		},
+	}
+}
+
+// Do 执行一次请求，失败时按 Retries 次数退避重试（第 n 次重试前等待 n²×100ms，最多 2s）。
+func (a *Api) Do(build func() (*http.Request, error)) (*http.Response, error) {
+	client := a.Client()
+	var lastErr error
+	for attempt := 0; attempt <= a.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff(attempt))
+		}
+		req, err := build()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func backoff(attempt int) time.Duration {
+	d := time.Duration(attempt*attempt) * 100 * time.Millisecond
+	if d > 2*time.Second {
+		d = 2 * time.Second
+	}
+	return d
+}
+
+type routeEntry struct {
+	Service *Service
+	Api     *Api
+}
+
+type table struct {
+	byPath map[string]routeEntry
+}
+
+var current unsafe.Pointer // *table
+
+// Dir 是启动时加载服务描述文件的目录。
+var Dir = "./services"
+
+func init() {
+	atomic.StorePointer(&current, unsafe.Pointer(defaultTable()))
+}
+
+// defaultTable 在 services 目录缺失或为空时提供的兜底路由，
+// 对应改造前写死的 network/report 两个端点。
+func defaultTable() *table {
+	network := &Api{
+		Name:        "network",
+		Method:      http.MethodPost,
+		Path:        "/api/v1/rta/network",
+		UpstreamURL: "https://growth-rta.tiktokv-us.com/api/v1/rta/network",
+		TimeoutMS:   5000,
+	}
+	report := &Api{
+		Name:        "report",
+		Method:      http.MethodPost,
+		Path:        "/api/v1/rta/report",
+		UpstreamURL: "https://growth-rta.tiktokv-us.com/api/v1/rta/report",
+		TimeoutMS:   5000,
+	}
+	network.buildClient()
+	report.buildClient()
+	svc := &Service{Name: "rta", Apis: []*Api{network, report}}
+	return &table{byPath: map[string]routeEntry{
+		network.Path: {Service: svc, Api: network},
+		report.Path:  {Service: svc, Api: report},
+	}}
+}
+
+// Load 从 Dir 读取所有 *.json 服务描述文件并原子替换路由表。
+// 目录不存在或没有有效的服务文件时保留当前路由表（启动时即兜底的 network/report 路由）。
+func Load() {
+	entries, err := os.ReadDir(Dir)
+	if err != nil {
+		log.Printf("registry: failed to read services dir %q: %v, keeping previous routes", Dir, err)
+		return
+	}
+
+	byPath := map[string]routeEntry{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		svc, err := loadService(filepath.Join(Dir, e.Name()))
+		if err != nil {
+			log.Printf("registry: failed to load %s: %v", e.Name(), err)
+			continue
+		}
+		for _, api := range svc.Apis {
+			if api.Path == "" {
+				continue
+			}
+			byPath[api.Path] = routeEntry{Service: svc, Api: api}
+		}
+	}
+
+	if len(byPath) == 0 {
+		log.Printf("registry: %s has no valid service files, keeping previous routes", Dir)
+		return
+	}
+
+	atomic.StorePointer(&current, unsafe.Pointer(&table{byPath: byPath}))
+	log.Printf("registry: loaded %d routes from %s", len(byPath), Dir)
+}
+
+func loadService(path string) (*Service, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var svc Service
+	if err := json.NewDecoder(f).Decode(&svc); err != nil {
+		return nil, err
+	}
+	for _, api := range svc.Apis {
+		api.buildClient()
+	}
+	return &svc, nil
+}
+
+// Lookup 按对外路径查找注册的接口定义。
+func Lookup(path string) (*Service, *Api, bool) {
+	t := (*table)(atomic.LoadPointer(&current))
+	entry, ok := t.byPath[path]
+	if !ok {
+		return nil, nil, false
+	}
+	return entry.Service, entry.Api, true
+}
@@ -0,0 +1,30 @@
+package main
+
+import "bytes"
+
+// boundedSink 是一个只保留前 cap 字节的 io.Writer，用作 io.TeeReader 的落点，
+// 让日志采样不必为大请求/响应体分配和它同样大的内存。
+type boundedSink struct {
+	buf *bytes.Buffer
+	cap int
+}
+
+func newBoundedSink(capBytes int) *boundedSink {
+	return &boundedSink{buf: &bytes.Buffer{}, cap: capBytes}
+}
+
+func (s *boundedSink) Write(p []byte) (int, error) {
+	if room := s.cap - s.buf.Len(); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		s.buf.Write(p[:room])
+	}
+	// 对调用方（io.TeeReader/io.Copy）而言，这次写入总是“成功”的，
+	// 只是超过 cap 的部分被悄悄丢弃，不影响真正的数据转发。
+	return len(p), nil
+}
+
+func (s *boundedSink) Bytes() []byte {
+	return s.buf.Bytes()
+}